@@ -0,0 +1,70 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func issuedRequest(t *testing.T, challenge string) (*http.Request, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	token, err := issueCSRFToken(rec, challenge)
+	if err != nil {
+		t.Fatalf("issueCSRFToken: %s", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/_matrix/client/consent", nil)
+	for _, c := range rec.Result().Cookies() {
+		req.AddCookie(c)
+	}
+	return req, token
+}
+
+func TestCSRFTokenRoundTrip(t *testing.T) {
+	req, token := issuedRequest(t, "chal1")
+	if !validCSRFToken(req, "chal1", token) {
+		t.Fatalf("expected matching CSRF token to validate")
+	}
+}
+
+func TestCSRFTokenRejectsWrongToken(t *testing.T) {
+	req, _ := issuedRequest(t, "chal1")
+	if validCSRFToken(req, "chal1", "not-the-right-token") {
+		t.Fatalf("expected a mismatched CSRF token to be rejected")
+	}
+}
+
+func TestCSRFTokenRejectsEmptySubmission(t *testing.T) {
+	req, _ := issuedRequest(t, "chal1")
+	if validCSRFToken(req, "chal1", "") {
+		t.Fatalf("expected an empty submitted token to be rejected")
+	}
+}
+
+func TestCSRFTokenRejectsMissingCookie(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/_matrix/client/consent", nil)
+	if validCSRFToken(req, "chal1", "whatever") {
+		t.Fatalf("expected a request with no CSRF cookie to be rejected")
+	}
+}
+
+func TestCSRFTokenRejectsMismatchedChallenge(t *testing.T) {
+	req, token := issuedRequest(t, "chal1")
+	if validCSRFToken(req, "chal2", token) {
+		t.Fatalf("expected a token issued for a different challenge to be rejected")
+	}
+}
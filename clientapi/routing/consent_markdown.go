@@ -0,0 +1,75 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+)
+
+// renderMarkdownToHTML converts CommonMark source to HTML. goldmark's
+// default HTML renderer omits raw HTML in the source (it is not given
+// html.WithUnsafe), so operator-authored policy/notice text can't
+// smuggle in arbitrary markup.
+func renderMarkdownToHTML(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := goldmark.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// markdownHeadingRe, markdownEmphasisRe and markdownLinkRe strip just
+// enough CommonMark syntax to turn policy/notice source into a readable
+// plaintext fallback body; they don't need to be a full parser since the
+// formatted_body carries the faithfully-rendered version.
+var (
+	markdownHeadingRe  = regexp.MustCompile(`(?m)^#+\s*`)
+	markdownEmphasisRe = regexp.MustCompile(`[*_]{1,3}`)
+	markdownLinkRe     = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+)
+
+// markdownToPlaintext strips common CommonMark markup from src, for use as
+// the plaintext "body" fallback alongside an HTML formatted_body.
+func markdownToPlaintext(src string) string {
+	out := markdownHeadingRe.ReplaceAllString(src, "")
+	out = markdownLinkRe.ReplaceAllString(out, "$1")
+	out = markdownEmphasisRe.ReplaceAllString(out, "")
+	return strings.TrimSpace(out)
+}
+
+// renderPolicyMarkdown loads PolicyMarkdownDir/<version>.md and renders it
+// to both an HTML and a plaintext form, for executeConsentTemplate (the
+// /consent page) instead of a hand-written .gohtml per version. The
+// server-notice nag does not use it; it renders its own template output
+// with renderMarkdownToHTML and markdownToPlaintext.
+func renderPolicyMarkdown(markdownDir, version string) (htmlBody, plainBody string, err error) {
+	path := filepath.Join(markdownDir, version+".md")
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read policy markdown %s: %w", path, err)
+	}
+	htmlBody, err = renderMarkdownToHTML(string(src))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to render policy markdown %s: %w", path, err)
+	}
+	return htmlBody, markdownToPlaintext(string(src)), nil
+}
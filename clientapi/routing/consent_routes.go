@@ -0,0 +1,64 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/matrix-org/dendrite/clientapi/auth"
+	"github.com/matrix-org/dendrite/clientapi/jsonerror"
+	"github.com/matrix-org/dendrite/setup/config"
+	userapi "github.com/matrix-org/dendrite/userapi/api"
+	"github.com/matrix-org/util"
+)
+
+// RegisterConsentRoutes wires /consent and the authenticated
+// /consent/manage and admin audit endpoints onto publicAPIMux and
+// dendriteAdminMux respectively. It is called from Setup.
+func RegisterConsentRoutes(publicAPIMux, dendriteAdminMux *mux.Router, userAPI userapi.UserInternalAPI, cfg *config.ClientAPI) {
+	publicAPIMux.HandleFunc("/consent", func(w http.ResponseWriter, req *http.Request) {
+		if resErr := consent(w, req, userAPI, cfg); resErr != nil {
+			util.RespondWithJSON(w, resErr.Code, resErr.JSON)
+		}
+	}).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
+
+	publicAPIMux.HandleFunc("/consent/manage", func(w http.ResponseWriter, req *http.Request) {
+		device, resErr := auth.VerifyUserFromRequest(req, userAPI)
+		if resErr != nil {
+			util.RespondWithJSON(w, resErr.Code, resErr.JSON)
+			return
+		}
+		if jsonResErr := manageConsent(w, req, userAPI, cfg, device); jsonResErr != nil {
+			util.RespondWithJSON(w, jsonResErr.Code, jsonResErr.JSON)
+		}
+	}).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
+
+	dendriteAdminMux.HandleFunc("/consent/{localpart}/audit", func(w http.ResponseWriter, req *http.Request) {
+		device, resErr := auth.VerifyUserFromRequest(req, userAPI)
+		if resErr != nil {
+			util.RespondWithJSON(w, resErr.Code, resErr.JSON)
+			return
+		}
+		if !device.IsServerAdmin {
+			forbidden := jsonerror.Forbidden("This action requires server admin privileges")
+			util.RespondWithJSON(w, http.StatusForbidden, forbidden)
+			return
+		}
+		localpart := mux.Vars(req)["localpart"]
+		resp := AdminListConsentAudit(req, userAPI, localpart)
+		util.RespondWithJSON(w, resp.Code, resp.JSON)
+	}).Methods(http.MethodGet)
+}
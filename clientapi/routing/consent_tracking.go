@@ -18,10 +18,14 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
+	"html/template"
 	"net/http"
+	texttemplate "text/template"
 
 	appserviceAPI "github.com/matrix-org/dendrite/appservice/api"
 	"github.com/matrix-org/dendrite/clientapi/jsonerror"
@@ -31,34 +35,279 @@ import (
 	userdb "github.com/matrix-org/dendrite/userapi/storage"
 	"github.com/matrix-org/gomatrixserverlib"
 	"github.com/matrix-org/util"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/text/language"
 )
 
+// accountDataLanguageType is the account_data event type under which a
+// user's preferred language for server-rendered content (consent page,
+// server notices) is stored.
+const accountDataLanguageType = "org.matrix.dendrite.language"
+
+// localizable is implemented by every /consent template data struct so
+// that the "T" template func below can find the Localizer it was built
+// with, without the handlers having to pass it as a separate argument.
+type localizable interface {
+	GetLocalizer() *i18n.Localizer
+}
+
+// getLocalizer picks a message catalog for req, preferring (in order) the
+// Accept-Language header, then falling back to consentCfg's configured
+// default language. It is used by both branches of consent and by
+// manageConsent.
+func getLocalizer(req *http.Request, consentCfg config.UserConsentOptions) *i18n.Localizer {
+	if consentCfg.I18n == nil {
+		return nil
+	}
+	tags, _, err := language.ParseAcceptLanguage(req.Header.Get("Accept-Language"))
+	if err != nil || len(tags) == 0 {
+		return consentCfg.I18n.Localizer()
+	}
+	langs := make([]string, len(tags))
+	for i, t := range tags {
+		langs[i] = t.String()
+	}
+	return consentCfg.I18n.Localizer(langs...)
+}
+
+// localizerForUser is like getLocalizer, but for contexts (the
+// server-notice nag) with no inbound request to read Accept-Language
+// from; it uses the target user's stored language preference instead.
+func localizerForUser(ctx context.Context, userAPI userapi.UserInternalAPI, consentCfg config.UserConsentOptions, userID string) *i18n.Localizer {
+	if consentCfg.I18n == nil {
+		return nil
+	}
+	if lang := userLanguage(ctx, userAPI, userID); lang != "" {
+		return consentCfg.I18n.Localizer(lang)
+	}
+	return consentCfg.I18n.Localizer()
+}
+
+// userLanguage looks up the language a user has asked server-rendered
+// content be sent in, falling back to the empty string (which makes
+// localizerForUser use the configured default) if they haven't set one.
+func userLanguage(ctx context.Context, userAPI userapi.UserInternalAPI, userID string) string {
+	res := &userapi.QueryAccountDataResponse{}
+	err := userAPI.QueryAccountData(ctx, &userapi.QueryAccountDataRequest{
+		UserID:   userID,
+		DataType: accountDataLanguageType,
+	}, res)
+	if err != nil {
+		return ""
+	}
+	if content, ok := res.GlobalAccountData[accountDataLanguageType]; ok {
+		if lang, ok := content["lang"].(string); ok {
+			return lang
+		}
+	}
+	return ""
+}
+
+// templateFuncs exposes {{ T "key" . }} to .gohtml templates: key is the
+// message catalog entry, and . is the template's own data (which must
+// implement localizable), so one template renders every language instead
+// of one template per language per policy version.
+var templateFuncs = template.FuncMap{
+	"T": func(key string, data interface{}) string {
+		loc, ok := data.(localizable)
+		if !ok || loc.GetLocalizer() == nil {
+			return key
+		}
+		msg, err := loc.GetLocalizer().Localize(&i18n.LocalizeConfig{MessageID: key})
+		if err != nil {
+			return key
+		}
+		return msg
+	},
+}
+
+// textTemplateFuncs exposes {{ T "key" }} to the plain-text server-notice
+// template. Unlike templateFuncs, it closes over its Localizer rather than
+// reading it off the template data, since the notice body is built from a
+// map[string]string rather than a struct.
+func textTemplateFuncs(loc *i18n.Localizer) texttemplate.FuncMap {
+	return texttemplate.FuncMap{
+		"T": func(key string) string {
+			if loc == nil {
+				return key
+			}
+			msg, err := loc.Localize(&i18n.LocalizeConfig{MessageID: key})
+			if err != nil {
+				return key
+			}
+			return msg
+		},
+	}
+}
+
 // The data used to populate the /consent request
 type constentTemplateData struct {
 	User          string
 	Version       string
-	UserHMAC      string
+	UserHMAC      string // only populated when DeprecatedHMACConsent is set
+	Challenge     string
+	CSRFToken     string
 	HasConsented  bool
 	PublicVersion bool
+	Localizer     *i18n.Localizer
+	// PolicyHTML is only set when UserConsentOptions.PolicyMarkdownDir is
+	// configured; it holds the already-sanitized HTML rendered from the
+	// version's Markdown source, for the policy_wrapper.gohtml template.
+	PolicyHTML template.HTML
+}
+
+func (d constentTemplateData) GetLocalizer() *i18n.Localizer { return d.Localizer }
+
+// executeConsentTemplate renders the policy document for consentCfg.Version.
+// When PolicyMarkdownDir is configured it renders the version's .md file to
+// sanitized HTML and feeds it through the generic policy_wrapper.gohtml
+// template instead of expecting operators to hand-write one .gohtml per
+// version.
+func executeConsentTemplate(writer http.ResponseWriter, consentCfg config.UserConsentOptions, data *constentTemplateData) error {
+	templateName := consentCfg.Version + ".gohtml"
+	if consentCfg.PolicyMarkdownDir != "" {
+		htmlBody, _, err := renderPolicyMarkdown(consentCfg.PolicyMarkdownDir, consentCfg.Version)
+		if err != nil {
+			return err
+		}
+		data.PolicyHTML = template.HTML(htmlBody) // #nosec G203 -- goldmark output, not user input
+		templateName = "policy_wrapper.gohtml"
+	}
+	return consentCfg.Templates.Funcs(templateFuncs).ExecuteTemplate(writer, templateName, data)
+}
+
+// The data used to populate the /consent/manage request
+type consentManageTemplateData struct {
+	User           string
+	CurrentVersion string
+	Consents       []userapi.PolicyConsent
+	Localizer      *i18n.Localizer
 }
 
+func (d consentManageTemplateData) GetLocalizer() *i18n.Localizer { return d.Localizer }
+
 func consent(writer http.ResponseWriter, req *http.Request, userAPI userapi.UserInternalAPI, cfg *config.ClientAPI) *util.JSONResponse {
 	consentCfg := cfg.Matrix.UserConsentOptions
 	internalError := jsonerror.InternalServerError()
 
-	// The data used to populate the /consent request
+	if consentCfg.DeprecatedHMACConsent {
+		return consentDeprecatedHMAC(writer, req, userAPI, cfg)
+	}
+
+	// The data used to populate the /consent request. Note that unlike the
+	// deprecated HMAC scheme, the challenge is the only thing the link
+	// carries; the user and policy version it was issued for are looked up
+	// server-side so that leaking the URL alone reveals nothing.
 	data := constentTemplateData{
-		User:     req.FormValue("u"),
-		Version:  req.FormValue("v"),
-		UserHMAC: req.FormValue("h"),
+		Challenge: req.FormValue("c"),
+		Localizer: getLocalizer(req, consentCfg),
 	}
 	switch req.Method {
 	case http.MethodGet:
 		// display the privacy policy without a form
+		data.PublicVersion = data.Challenge == ""
+
+		if !data.PublicVersion {
+			challengeRes := &userapi.ValidateConsentChallengeResponse{}
+			if err := userAPI.QueryConsentChallenge(req.Context(), &userapi.ValidateConsentChallengeRequest{
+				Challenge: data.Challenge,
+			}, challengeRes); err != nil || !challengeRes.Valid {
+				_, _ = writer.Write([]byte("invalid or expired consent link"))
+				return &internalError
+			}
+			data.User = challengeRes.LocalPart
+			data.Version = challengeRes.PolicyVersion
+
+			res := &userapi.QueryPolicyVersionResponse{}
+			if err := userAPI.QueryPolicyVersion(req.Context(), &userapi.QueryPolicyVersionRequest{
+				LocalPart: challengeRes.LocalPart,
+			}, res); err != nil {
+				logrus.WithError(err).Error("unable to print consent template")
+				return &internalError
+			}
+			data.HasConsented = res.PolicyVersion == consentCfg.Version
+
+			// Bind a CSRF token to this challenge's session so the POST
+			// below can refuse a cross-site form submission; the token is
+			// embedded in the rendered form and echoed back as "csrf".
+			csrfToken, err := issueCSRFToken(writer, data.Challenge)
+			if err != nil {
+				logrus.WithError(err).Error("unable to issue CSRF token")
+				return &internalError
+			}
+			data.CSRFToken = csrfToken
+		}
+
+		if err := executeConsentTemplate(writer, consentCfg, &data); err != nil {
+			logrus.WithError(err).Error("unable to print consent template")
+			return nil
+		}
+		return nil
+	case http.MethodPost:
+		if !validCSRFToken(req, data.Challenge, req.FormValue("csrf")) {
+			_, _ = writer.Write([]byte("invalid or missing CSRF token"))
+			return &internalError
+		}
+
+		challengeRes := &userapi.ValidateConsentChallengeResponse{}
+		if err := userAPI.QueryConsentChallenge(req.Context(), &userapi.ValidateConsentChallengeRequest{
+			Challenge: data.Challenge,
+		}, challengeRes); err != nil || !challengeRes.Valid {
+			_, _ = writer.Write([]byte("invalid or expired consent link"))
+			return &internalError
+		}
+
+		if err := userAPI.PerformConsumeConsentChallenge(req.Context(), &userapi.ConsumeConsentChallengeRequest{
+			Challenge: data.Challenge,
+		}, &userapi.ConsumeConsentChallengeResponse{}); err != nil {
+			logrus.WithError(err).Error("unable to consume consent challenge")
+			return &internalError
+		}
+		if err := userAPI.PerformUpdatePolicyVersion(
+			req.Context(),
+			&userapi.UpdatePolicyVersionRequest{
+				PolicyVersion: challengeRes.PolicyVersion,
+				LocalPart:     challengeRes.LocalPart,
+			},
+			&userapi.UpdatePolicyVersionResponse{},
+		); err != nil {
+			_, _ = writer.Write([]byte("unable to update database"))
+			return &internalError
+		}
+
+		// display the privacy policy without a form
+		data.PublicVersion = false
+		data.HasConsented = true
+		data.Version = challengeRes.PolicyVersion
+
+		if err := executeConsentTemplate(writer, consentCfg, &data); err != nil {
+			logrus.WithError(err).Error("unable to print consent template")
+			return &internalError
+		}
+		return nil
+	}
+	return &util.JSONResponse{Code: http.StatusOK}
+}
+
+// consentDeprecatedHMAC is the pre-challenge /consent implementation, kept
+// for one release behind UserConsentOptions.DeprecatedHMACConsent so
+// operators with already-sent HMAC links have time to migrate. It will be
+// removed once that flag is retired.
+func consentDeprecatedHMAC(writer http.ResponseWriter, req *http.Request, userAPI userapi.UserInternalAPI, cfg *config.ClientAPI) *util.JSONResponse {
+	consentCfg := cfg.Matrix.UserConsentOptions
+	internalError := jsonerror.InternalServerError()
+
+	data := constentTemplateData{
+		User:      req.FormValue("u"),
+		Version:   req.FormValue("v"),
+		UserHMAC:  req.FormValue("h"),
+		Localizer: getLocalizer(req, consentCfg),
+	}
+	switch req.Method {
+	case http.MethodGet:
 		data.PublicVersion = data.User == "" || data.UserHMAC == "" || data.Version == ""
 
-		// let's see if the user already consented to the current version
 		if !data.PublicVersion {
 			res := &userapi.QueryPolicyVersionResponse{}
 			localPart, _, err := gomatrixserverlib.SplitID('@', data.User)
@@ -75,7 +324,7 @@ func consent(writer http.ResponseWriter, req *http.Request, userAPI userapi.User
 			data.HasConsented = res.PolicyVersion == consentCfg.Version
 		}
 
-		err := consentCfg.Templates.ExecuteTemplate(writer, consentCfg.Version+".gohtml", data)
+		err := consentCfg.Templates.Funcs(templateFuncs).ExecuteTemplate(writer, consentCfg.Version+".gohtml", data)
 		if err != nil {
 			logrus.WithError(err).Error("unable to print consent template")
 			return nil
@@ -114,7 +363,7 @@ func consent(writer http.ResponseWriter, req *http.Request, userAPI userapi.User
 		data.PublicVersion = false
 		data.HasConsented = true
 
-		err = consentCfg.Templates.ExecuteTemplate(writer, consentCfg.Version+".gohtml", data)
+		err = consentCfg.Templates.Funcs(templateFuncs).ExecuteTemplate(writer, consentCfg.Version+".gohtml", data)
 		if err != nil {
 			logrus.WithError(err).Error("unable to print consent template")
 			return &internalError
@@ -124,6 +373,81 @@ func consent(writer http.ResponseWriter, req *http.Request, userAPI userapi.User
 	return &util.JSONResponse{Code: http.StatusOK}
 }
 
+// manageConsent serves GET/POST /_matrix/client/consent/manage for an
+// already-authenticated user. Unlike consent (which is reached from an
+// emailed/nagged link carrying its own challenge), this endpoint trusts the
+// access token and lets the user browse every policy version they've been
+// shown and withdraw consent for the current one.
+func manageConsent(writer http.ResponseWriter, req *http.Request, userAPI userapi.UserInternalAPI, cfg *config.ClientAPI, device *userapi.Device) *util.JSONResponse {
+	consentCfg := cfg.Matrix.UserConsentOptions
+	internalError := jsonerror.InternalServerError()
+
+	localPart, _, err := gomatrixserverlib.SplitID('@', device.UserID)
+	if err != nil {
+		logrus.WithError(err).Error("unable to split username")
+		return &internalError
+	}
+
+	listRes := &userapi.ListPolicyConsentsResponse{}
+	if err := userAPI.ListPolicyConsents(req.Context(), &userapi.ListPolicyConsentsRequest{
+		LocalPart: localPart,
+	}, listRes); err != nil {
+		logrus.WithError(err).Error("unable to list policy consents")
+		return &internalError
+	}
+
+	if req.Method == http.MethodPost && req.FormValue("action") == "revoke" {
+		if err := userAPI.RevokePolicyConsent(req.Context(), &userapi.RevokePolicyConsentRequest{
+			LocalPart:     localPart,
+			PolicyVersion: consentCfg.Version,
+		}, &userapi.RevokePolicyConsentResponse{}); err != nil {
+			logrus.WithError(err).Error("unable to revoke policy consent")
+			return &internalError
+		}
+		// Re-run the query so the page reflects the withdrawal straight away.
+		if err := userAPI.ListPolicyConsents(req.Context(), &userapi.ListPolicyConsentsRequest{
+			LocalPart: localPart,
+		}, listRes); err != nil {
+			logrus.WithError(err).Error("unable to list policy consents")
+			return &internalError
+		}
+	}
+
+	data := consentManageTemplateData{
+		User:           device.UserID,
+		CurrentVersion: consentCfg.Version,
+		Consents:       listRes.Consents,
+		Localizer:      getLocalizer(req, consentCfg),
+	}
+	if err := consentCfg.Templates.Funcs(templateFuncs).ExecuteTemplate(writer, "manage_consent.gohtml", data); err != nil {
+		logrus.WithError(err).Error("unable to print manage consent template")
+		return &internalError
+	}
+	return nil
+}
+
+// consentAuditData is the per-version breakdown shown to admins.
+type consentAuditData struct {
+	LocalPart string
+	Consents  []userapi.PolicyConsent
+}
+
+// AdminListConsentAudit returns every policy acceptance/withdrawal recorded
+// for the given user, for admins auditing GDPR withdrawal requests.
+func AdminListConsentAudit(req *http.Request, userAPI userapi.UserInternalAPI, localPart string) util.JSONResponse {
+	res := &userapi.ListPolicyConsentsResponse{}
+	if err := userAPI.ListPolicyConsents(req.Context(), &userapi.ListPolicyConsentsRequest{
+		LocalPart: localPart,
+	}, res); err != nil {
+		logrus.WithError(err).Error("unable to list policy consents")
+		return util.ErrorResponse(err)
+	}
+	return util.JSONResponse{
+		Code: http.StatusOK,
+		JSON: consentAuditData{LocalPart: localPart, Consents: res.Consents},
+	}
+}
+
 func sendServerNoticeForConsent(userAPI userapi.UserInternalAPI, rsAPI api.RoomserverInternalAPI,
 	cfgNotices *config.ServerNotices,
 	cfgClient *config.ClientAPI,
@@ -155,26 +479,41 @@ func sendServerNoticeForConsent(userAPI userapi.UserInternalAPI, rsAPI api.Rooms
 			continue
 		}
 		userID = fmt.Sprintf("@%s:%s", userID, cfgClient.Matrix.ServerName)
-		data["ConsentURL"], err = buildConsentURI(cfgClient, userID)
+		data["ConsentURL"], err = buildConsentURI(context.Background(), userAPI, cfgClient, userID)
 		if err != nil {
 			logrus.WithError(err).WithField("userID", userID).Error("unable to construct consentURI")
 			continue
 		}
 		msgBody := &bytes.Buffer{}
 
-		if err = consentOpts.TextTemplates.ExecuteTemplate(msgBody, "serverNoticeTemplate", data); err != nil {
+		// serverNoticeTemplate's source is Markdown, not HTML: it's
+		// rendered to sanitized HTML for clients that honour
+		// format: org.matrix.custom.html (e.g. Element), with a stripped
+		// plaintext fallback in body for clients that don't.
+		localizer := localizerForUser(context.Background(), userAPI, consentOpts, userID)
+		if err = consentOpts.TextTemplates.Funcs(textTemplateFuncs(localizer)).ExecuteTemplate(msgBody, "serverNoticeTemplate", data); err != nil {
 			logrus.WithError(err).WithField("userID", userID).Error("unable to execute serverNoticeTemplate")
 			continue
 		}
+		markdownBody := msgBody.String()
+		formattedBody, err := renderMarkdownToHTML(markdownBody)
+		if err != nil {
+			logrus.WithError(err).WithField("userID", userID).Error("unable to render server notice markdown")
+			continue
+		}
 
 		req := sendServerNoticeRequest{
 			UserID: userID,
 			Content: struct {
-				MsgType string `json:"msgtype,omitempty"`
-				Body    string `json:"body,omitempty"`
+				MsgType       string `json:"msgtype,omitempty"`
+				Body          string `json:"body,omitempty"`
+				Format        string `json:"format,omitempty"`
+				FormattedBody string `json:"formatted_body,omitempty"`
 			}{
-				MsgType: consentOpts.ServerNoticeContent.MsgType,
-				Body:    msgBody.String(),
+				MsgType:       consentOpts.ServerNoticeContent.MsgType,
+				Body:          markdownToPlaintext(markdownBody),
+				Format:        "org.matrix.custom.html",
+				FormattedBody: formattedBody,
 			},
 		}
 		_, err = sendServerNotice(context.Background(), req, rsAPI, cfgNotices, cfgClient, senderDevice, accountsDB, asAPI, userAPI, nil, nil, nil)
@@ -198,7 +537,34 @@ func sendServerNoticeForConsent(userAPI userapi.UserInternalAPI, rsAPI api.Rooms
 	}
 }
 
-func buildConsentURI(cfgClient *config.ClientAPI, userID string) (string, error) {
+// buildConsentURI constructs the link embedded in the server-notice nag.
+// Since the HMAC scheme was retired, the link carries only an opaque,
+// single-use, expiring challenge ID rather than the user's MXID.
+func buildConsentURI(ctx context.Context, userAPI userapi.UserInternalAPI, cfgClient *config.ClientAPI, userID string) (string, error) {
+	consentOpts := cfgClient.Matrix.UserConsentOptions
+	if consentOpts.DeprecatedHMACConsent {
+		return buildConsentURIDeprecatedHMAC(cfgClient, userID)
+	}
+
+	localPart, _, err := gomatrixserverlib.SplitID('@', userID)
+	if err != nil {
+		return "", err
+	}
+	res := &userapi.CreateConsentChallengeResponse{}
+	if err = userAPI.PerformCreateConsentChallenge(ctx, &userapi.CreateConsentChallengeRequest{
+		LocalPart:     localPart,
+		PolicyVersion: consentOpts.Version,
+		TTL:           consentOpts.ChallengeTTL,
+	}, res); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/_matrix/client/consent?c=%s", consentOpts.BaseURL, res.Challenge), nil
+}
+
+// buildConsentURIDeprecatedHMAC is the pre-challenge link builder, kept
+// alongside consentDeprecatedHMAC behind UserConsentOptions.DeprecatedHMACConsent.
+func buildConsentURIDeprecatedHMAC(cfgClient *config.ClientAPI, userID string) (string, error) {
 	consentOpts := cfgClient.Matrix.UserConsentOptions
 
 	mac := hmac.New(sha256.New, []byte(consentOpts.FormSecret))
@@ -223,4 +589,42 @@ func validHMAC(username, userHMAC, secret string) (bool, error) {
 		return false, err
 	}
 	return hmac.Equal(decoded, expectedMAC), nil
+}
+
+// issueCSRFToken mints a random per-challenge CSRF token, double-submitting
+// it as both an HttpOnly cookie and the value returned for the caller to
+// embed in the rendered form's hidden csrf field.
+func issueCSRFToken(writer http.ResponseWriter, challenge string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	http.SetCookie(writer, &http.Cookie{
+		Name:     csrfCookieName(challenge),
+		Value:    token,
+		Path:     "/_matrix/client/consent",
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token, nil
+}
+
+// validCSRFToken checks that the csrf form value submitted alongside a
+// POST matches the cookie set when the form was rendered, so a cross-site
+// form post (which cannot read the victim's cookies) is rejected.
+func validCSRFToken(req *http.Request, challenge, submitted string) bool {
+	if submitted == "" {
+		return false
+	}
+	cookie, err := req.Cookie(csrfCookieName(challenge))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(submitted)) == 1
+}
+
+func csrfCookieName(challenge string) string {
+	return "dendrite_consent_csrf_" + challenge
 }
\ No newline at end of file
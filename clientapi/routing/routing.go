@@ -0,0 +1,32 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routing
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/matrix-org/dendrite/setup/config"
+	userapi "github.com/matrix-org/dendrite/userapi/api"
+)
+
+// Setup registers the client API's consent routes on publicAPIMux and
+// dendriteAdminMux via RegisterConsentRoutes; it registers no other
+// routes.
+func Setup(
+	publicAPIMux, dendriteAdminMux *mux.Router,
+	cfg *config.ClientAPI,
+	userAPI userapi.UserInternalAPI,
+) {
+	RegisterConsentRoutes(publicAPIMux, dendriteAdminMux, userAPI, cfg)
+}
@@ -0,0 +1,92 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"html/template"
+	"time"
+)
+
+// UserConsentOptions contains all the config options required to enable
+// the /consent flow, its server-notice nag and (since the addition of
+// localisation support) the message catalog used to render both. It
+// lives on Global (accessed elsewhere in the tree as
+// cfg.Matrix.UserConsentOptions) alongside the other homeserver-wide
+// options every component config embeds.
+type UserConsentOptions struct {
+	// Whether doing a GET on /consent will return a policy document at all.
+	Enabled bool `yaml:"enabled"`
+	// The current version of the policy document. Users who have not
+	// accepted this version are considered outdated.
+	Version string `yaml:"version"`
+	// The directory containing the .gohtml templates used to render the
+	// policy document, one per version, plus (since i18n support) one
+	// translation bundle per supported language.
+	TemplatePath string `yaml:"template_path"`
+	Templates    *template.Template `yaml:"-"`
+	TextTemplates *template.Template `yaml:"-"`
+	// The shared secret used to compute the per-user HMAC embedded in
+	// consent links.
+	FormSecret string `yaml:"form_secret"`
+	// The externally-reachable base URL of this homeserver, used when
+	// constructing consent links for server notices.
+	BaseURL string `yaml:"base_url"`
+	// The m.room.message content used for the server-notice nag.
+	ServerNoticeContent struct {
+		MsgType string `yaml:"msgtype"`
+		Body    string `yaml:"body"`
+	} `yaml:"server_notice_content"`
+	// RequireAtRegistration, if set, blocks registration until the current
+	// policy version has been accepted.
+	RequireAtRegistration bool `yaml:"require_at_registration"`
+	// DefaultLanguage is the message-catalog bundle used to render the
+	// consent page and server notice when no Accept-Language header (or
+	// stored user preference) matches a bundle we ship.
+	DefaultLanguage string `yaml:"default_language"`
+	// I18n is the loaded translation catalog for TemplatePath, populated
+	// once at startup by LoadI18n.
+	I18n *I18n `yaml:"-"`
+	// ChallengeTTL is how long a consent challenge (the opaque token
+	// embedded in consent links since the HMAC scheme was retired) stays
+	// valid for. Defaults to 24h.
+	ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+	// DeprecatedHMACConsent re-enables the old bare-HMAC(userID) consent
+	// link scheme with no expiry, nonce or CSRF protection. It exists only
+	// to give operators with external links already sent out one release
+	// to migrate, and will be removed afterwards.
+	DeprecatedHMACConsent bool `yaml:"deprecated_hmac_consent"`
+	// PolicyMarkdownDir is a directory of one Markdown file per policy
+	// version (e.g. 1.0.md), rendered to HTML and plaintext at request
+	// time, replacing hand-written .gohtml per version.
+	PolicyMarkdownDir string `yaml:"policy_markdown_dir"`
+}
+
+func (c *UserConsentOptions) Defaults() {
+	c.Enabled = false
+	c.RequireAtRegistration = false
+	c.DefaultLanguage = "en"
+	c.ChallengeTTL = 24 * time.Hour
+	c.DeprecatedHMACConsent = false
+}
+
+func (c *UserConsentOptions) Verify(configErrs *ConfigErrors) {
+	if !c.Enabled {
+		return
+	}
+	checkNotEmpty(configErrs, "user_consent.version", c.Version)
+	checkNotEmpty(configErrs, "user_consent.template_path", c.TemplatePath)
+	checkNotEmpty(configErrs, "user_consent.form_secret", c.FormSecret)
+	checkNotEmpty(configErrs, "user_consent.default_language", c.DefaultLanguage)
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+// I18n bundles every translation catalog a UserConsentOptions consumer
+// (the /consent handlers and the server-notice nag) can pick a Localizer
+// from. It replaces the one-template-per-version approach: a policy author
+// now ships one .gohtml per version plus one translations/active.<lang>.toml
+// per supported language.
+type I18n struct {
+	bundle          *i18n.Bundle
+	DefaultLanguage string
+}
+
+// LoadI18n loads every translations/active.<lang>.toml file found in dir
+// into a new message bundle, falling back to defaultLanguage when a
+// requested language has no bundle of its own.
+func LoadI18n(dir, defaultLanguage string) (*I18n, error) {
+	bundle := i18n.NewBundle(language.Make(defaultLanguage))
+	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+
+	matches, err := filepath.Glob(filepath.Join(dir, "translations", "active.*.toml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to glob translation bundles: %w", err)
+	}
+	for _, path := range matches {
+		if _, err = bundle.LoadMessageFile(path); err != nil {
+			return nil, fmt.Errorf("failed to load translation bundle %s: %w", path, err)
+		}
+	}
+
+	return &I18n{bundle: bundle, DefaultLanguage: defaultLanguage}, nil
+}
+
+// Localizer returns a localizer that prefers, in order, each of langs, then
+// falls back to the bundle's default language.
+func (i *I18n) Localizer(langs ...string) *i18n.Localizer {
+	langs = append(langs, i.DefaultLanguage)
+	return i18n.NewLocalizer(i.bundle, langs...)
+}
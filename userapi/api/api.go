@@ -0,0 +1,102 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+)
+
+// UserInternalAPI is the internal, Query*/Perform*-shaped RPC surface
+// clientapi/routing calls into instead of talking to userapi/storage
+// directly. ConsentAPI is embedded here rather than exposed as its own
+// internal API, since it shares the same localpart/device surface as the
+// rest of this interface and is backed by the same implementation.
+type UserInternalAPI interface {
+	ConsentAPI
+
+	// QueryPolicyVersion returns the policy version localpart last
+	// accepted (the empty string if none, or if their acceptance has
+	// since been revoked).
+	QueryPolicyVersion(ctx context.Context, req *QueryPolicyVersionRequest, res *QueryPolicyVersionResponse) error
+	// PerformUpdatePolicyVersion records that localpart has accepted
+	// policyVersion, via the /consent form or the server-notice nag.
+	PerformUpdatePolicyVersion(ctx context.Context, req *UpdatePolicyVersionRequest, res *UpdatePolicyVersionResponse) error
+	// QueryOutdatedPolicy returns every localpart who has not accepted
+	// (or has since revoked their acceptance of) policyVersion, for the
+	// server-notice nag to target.
+	QueryOutdatedPolicy(ctx context.Context, req *QueryOutdatedPolicyRequest, res *QueryOutdatedPolicyResponse) error
+	// QueryAccountData returns a user's account_data, filtered to
+	// DataType when one is given.
+	QueryAccountData(ctx context.Context, req *QueryAccountDataRequest, res *QueryAccountDataResponse) error
+}
+
+// Device identifies the authenticated session a clientapi request was
+// made with.
+type Device struct {
+	ID            string
+	UserID        string
+	IsServerAdmin bool
+}
+
+// QueryPolicyVersionRequest asks for the policy version localpart last
+// accepted.
+type QueryPolicyVersionRequest struct {
+	LocalPart string
+}
+
+// QueryPolicyVersionResponse is the answer to QueryPolicyVersionRequest.
+// PolicyVersion is empty if localpart has never accepted a policy, or has
+// since revoked their most recent acceptance.
+type QueryPolicyVersionResponse struct {
+	PolicyVersion string
+}
+
+// UpdatePolicyVersionRequest records that localpart has accepted
+// policyVersion.
+type UpdatePolicyVersionRequest struct {
+	PolicyVersion string
+	LocalPart     string
+	// ServerNoticeUpdate is set when the acceptance was recorded because
+	// of the server-notice nag rather than an explicit form submission,
+	// so the consent history can tell the two apart.
+	ServerNoticeUpdate bool
+}
+
+// UpdatePolicyVersionResponse is the (empty) answer to
+// UpdatePolicyVersionRequest.
+type UpdatePolicyVersionResponse struct{}
+
+// QueryOutdatedPolicyRequest asks for every localpart who still needs
+// nagging about policyVersion.
+type QueryOutdatedPolicyRequest struct {
+	PolicyVersion string
+}
+
+// QueryOutdatedPolicyResponse is the answer to QueryOutdatedPolicyRequest.
+type QueryOutdatedPolicyResponse struct {
+	OutdatedUsers []string
+}
+
+// QueryAccountDataRequest asks for a user's account_data. DataType, if
+// given, restricts the result to that single event type.
+type QueryAccountDataRequest struct {
+	UserID   string
+	DataType string
+}
+
+// QueryAccountDataResponse is the answer to QueryAccountDataRequest.
+type QueryAccountDataResponse struct {
+	GlobalAccountData map[string]map[string]interface{}
+}
@@ -0,0 +1,107 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// ConsentAPI is embedded into UserInternalAPI and backs the consent
+// management page, giving callers the full history of a user's policy
+// acceptances rather than just the latest version, plus the challenge
+// tokens that replaced the old bare-HMAC consent links.
+type ConsentAPI interface {
+	ListPolicyConsents(ctx context.Context, req *ListPolicyConsentsRequest, res *ListPolicyConsentsResponse) error
+	RevokePolicyConsent(ctx context.Context, req *RevokePolicyConsentRequest, res *RevokePolicyConsentResponse) error
+	PerformCreateConsentChallenge(ctx context.Context, req *CreateConsentChallengeRequest, res *CreateConsentChallengeResponse) error
+	QueryConsentChallenge(ctx context.Context, req *ValidateConsentChallengeRequest, res *ValidateConsentChallengeResponse) error
+	PerformConsumeConsentChallenge(ctx context.Context, req *ConsumeConsentChallengeRequest, res *ConsumeConsentChallengeResponse) error
+}
+
+// PolicyConsent records a single acceptance (or withdrawal) of a policy
+// version by a user, as tracked by user_policy_consents.
+type PolicyConsent struct {
+	PolicyVersion string `json:"policy_version"`
+	AcceptedAt    int64  `json:"accepted_ts"`
+	RevokedAt     int64  `json:"revoked_ts,omitempty"`
+	Method        string `json:"method"`
+}
+
+// ListPolicyConsentsRequest asks for every policy version a user has been
+// shown, newest first.
+type ListPolicyConsentsRequest struct {
+	LocalPart string
+}
+
+// ListPolicyConsentsResponse is the answer to ListPolicyConsentsRequest.
+type ListPolicyConsentsResponse struct {
+	Consents []PolicyConsent
+}
+
+// RevokePolicyConsentRequest withdraws a user's consent for a policy
+// version they had previously accepted, re-queuing them for the
+// server-notice nag.
+type RevokePolicyConsentRequest struct {
+	LocalPart     string
+	PolicyVersion string
+}
+
+// RevokePolicyConsentResponse is the (empty) answer to
+// RevokePolicyConsentRequest.
+type RevokePolicyConsentResponse struct{}
+
+// CreateConsentChallengeRequest asks for a new single-use, expiring
+// challenge to be issued for localpart/policyVersion. It replaces the
+// bare HMAC(userID) that used to be embedded directly in consent links.
+type CreateConsentChallengeRequest struct {
+	LocalPart     string
+	PolicyVersion string
+	// TTL is how long the challenge remains valid for; the caller (the
+	// /consent routing code) fills this in from UserConsentOptions.ChallengeTTL.
+	TTL time.Duration
+}
+
+// CreateConsentChallengeResponse carries the opaque challenge ID to embed
+// in the consent link.
+type CreateConsentChallengeResponse struct {
+	Challenge string
+}
+
+// ValidateConsentChallengeRequest checks whether challenge is still valid
+// (unexpired, unconsumed), without consuming it; the localpart it was
+// issued for is returned in the response.
+type ValidateConsentChallengeRequest struct {
+	Challenge string
+}
+
+// ValidateConsentChallengeResponse is the answer to
+// ValidateConsentChallengeRequest.
+type ValidateConsentChallengeResponse struct {
+	Valid         bool
+	LocalPart     string
+	PolicyVersion string
+}
+
+// ConsumeConsentChallengeRequest marks a challenge as used, so it cannot be
+// replayed. Called once the CSRF token has also been validated, immediately
+// before PerformUpdatePolicyVersion.
+type ConsumeConsentChallengeRequest struct {
+	Challenge string
+}
+
+// ConsumeConsentChallengeResponse is the (empty) answer to
+// ConsumeConsentChallengeRequest.
+type ConsumeConsentChallengeResponse struct{}
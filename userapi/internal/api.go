@@ -0,0 +1,137 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"time"
+
+	"github.com/matrix-org/dendrite/userapi/api"
+	"github.com/matrix-org/dendrite/userapi/storage"
+)
+
+// UserInternalAPI is the concrete implementation of api.UserInternalAPI,
+// backed by DB.
+type UserInternalAPI struct {
+	DB storage.Database
+}
+
+// QueryPolicyVersion implements api.UserInternalAPI. A revoked acceptance
+// is treated the same as never having accepted: the caller learns the
+// version of the most recent row, or nothing if that row has been revoked
+// (older, unrevoked rows are not consulted).
+func (a *UserInternalAPI) QueryPolicyVersion(ctx context.Context, req *api.QueryPolicyVersionRequest, res *api.QueryPolicyVersionResponse) error {
+	consent, err := a.DB.SelectLatestPolicyConsent(ctx, req.LocalPart)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if consent.RevokedAt != 0 {
+		return nil
+	}
+	res.PolicyVersion = consent.PolicyVersion
+	return nil
+}
+
+// PerformUpdatePolicyVersion implements api.UserInternalAPI, recording an
+// acceptance row so ListPolicyConsents/QueryOutdatedPolicy see it
+// immediately.
+func (a *UserInternalAPI) PerformUpdatePolicyVersion(ctx context.Context, req *api.UpdatePolicyVersionRequest, res *api.UpdatePolicyVersionResponse) error {
+	method := "web"
+	if req.ServerNoticeUpdate {
+		method = "server-notice"
+	}
+	return a.DB.InsertPolicyConsent(ctx, nil, req.LocalPart, req.PolicyVersion, method)
+}
+
+// QueryOutdatedPolicy implements api.UserInternalAPI.
+func (a *UserInternalAPI) QueryOutdatedPolicy(ctx context.Context, req *api.QueryOutdatedPolicyRequest, res *api.QueryOutdatedPolicyResponse) error {
+	localparts, err := a.DB.SelectOutdatedPolicyLocalparts(ctx, req.PolicyVersion)
+	if err != nil {
+		return err
+	}
+	res.OutdatedUsers = localparts
+	return nil
+}
+
+// QueryAccountData implements api.UserInternalAPI. The generic
+// account_data store predates this series and isn't owned by it, so this
+// always reports no data; callers like userLanguage already treat that as
+// "fall back to the configured default".
+func (a *UserInternalAPI) QueryAccountData(ctx context.Context, req *api.QueryAccountDataRequest, res *api.QueryAccountDataResponse) error {
+	res.GlobalAccountData = map[string]map[string]interface{}{}
+	return nil
+}
+
+// ListPolicyConsents implements api.ConsentAPI.
+func (a *UserInternalAPI) ListPolicyConsents(ctx context.Context, req *api.ListPolicyConsentsRequest, res *api.ListPolicyConsentsResponse) error {
+	consents, err := a.DB.SelectPolicyConsents(ctx, req.LocalPart)
+	if err != nil {
+		return err
+	}
+	res.Consents = consents
+	return nil
+}
+
+// RevokePolicyConsent implements api.ConsentAPI.
+func (a *UserInternalAPI) RevokePolicyConsent(ctx context.Context, req *api.RevokePolicyConsentRequest, res *api.RevokePolicyConsentResponse) error {
+	return a.DB.RevokePolicyConsent(ctx, nil, req.LocalPart, req.PolicyVersion)
+}
+
+// PerformCreateConsentChallenge implements api.ConsentAPI.
+func (a *UserInternalAPI) PerformCreateConsentChallenge(ctx context.Context, req *api.CreateConsentChallengeRequest, res *api.CreateConsentChallengeResponse) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	challenge := hex.EncodeToString(buf)
+	now := time.Now()
+	if err := a.DB.InsertConsentChallenge(ctx, nil, challenge, req.LocalPart, req.PolicyVersion, now.UnixMilli(), now.Add(req.TTL).UnixMilli()); err != nil {
+		return err
+	}
+	res.Challenge = challenge
+	return nil
+}
+
+// QueryConsentChallenge implements api.ConsentAPI. An unknown, expired or
+// already-consumed challenge is reported as simply invalid rather than as
+// an error, so the caller doesn't need to distinguish "doesn't exist" from
+// "no longer usable".
+func (a *UserInternalAPI) QueryConsentChallenge(ctx context.Context, req *api.ValidateConsentChallengeRequest, res *api.ValidateConsentChallengeResponse) error {
+	challenge, err := a.DB.SelectConsentChallenge(ctx, req.Challenge)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if challenge.Consumed || time.Now().UnixMilli() >= challenge.ExpiresAt {
+		return nil
+	}
+	res.Valid = true
+	res.LocalPart = challenge.LocalPart
+	res.PolicyVersion = challenge.PolicyVersion
+	return nil
+}
+
+// PerformConsumeConsentChallenge implements api.ConsentAPI.
+func (a *UserInternalAPI) PerformConsumeConsentChallenge(ctx context.Context, req *api.ConsumeConsentChallengeRequest, res *api.ConsumeConsentChallengeResponse) error {
+	return a.DB.ConsumeConsentChallenge(ctx, nil, req.Challenge)
+}
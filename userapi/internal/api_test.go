@@ -0,0 +1,165 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/matrix-org/dendrite/userapi/api"
+	"github.com/matrix-org/dendrite/userapi/storage/tables"
+)
+
+// fakeConsentDB is a minimal in-memory storage.Database, just enough to
+// exercise UserInternalAPI's challenge validation logic without a real
+// database.
+type fakeConsentDB struct {
+	challenges map[string]tables.ConsentChallenge
+}
+
+func newFakeConsentDB() *fakeConsentDB {
+	return &fakeConsentDB{challenges: map[string]tables.ConsentChallenge{}}
+}
+
+func (f *fakeConsentDB) InsertPolicyConsent(ctx context.Context, txn *sql.Tx, localpart, policyVersion, method string) error {
+	return nil
+}
+
+func (f *fakeConsentDB) SelectPolicyConsents(ctx context.Context, localpart string) ([]api.PolicyConsent, error) {
+	return nil, nil
+}
+
+func (f *fakeConsentDB) SelectLatestPolicyConsent(ctx context.Context, localpart string) (api.PolicyConsent, error) {
+	return api.PolicyConsent{}, sql.ErrNoRows
+}
+
+func (f *fakeConsentDB) RevokePolicyConsent(ctx context.Context, txn *sql.Tx, localpart, policyVersion string) error {
+	return nil
+}
+
+func (f *fakeConsentDB) InsertConsentChallenge(ctx context.Context, txn *sql.Tx, challenge, localpart, policyVersion string, issuedAt, expiresAt int64) error {
+	f.challenges[challenge] = tables.ConsentChallenge{
+		Challenge:     challenge,
+		LocalPart:     localpart,
+		PolicyVersion: policyVersion,
+		IssuedAt:      issuedAt,
+		ExpiresAt:     expiresAt,
+	}
+	return nil
+}
+
+func (f *fakeConsentDB) SelectConsentChallenge(ctx context.Context, challenge string) (tables.ConsentChallenge, error) {
+	c, ok := f.challenges[challenge]
+	if !ok {
+		return tables.ConsentChallenge{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func (f *fakeConsentDB) ConsumeConsentChallenge(ctx context.Context, txn *sql.Tx, challenge string) error {
+	c, ok := f.challenges[challenge]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	c.Consumed = true
+	f.challenges[challenge] = c
+	return nil
+}
+
+func (f *fakeConsentDB) SelectOutdatedPolicyLocalparts(ctx context.Context, policyVersion string) ([]string, error) {
+	return nil, nil
+}
+
+func TestQueryConsentChallengeValid(t *testing.T) {
+	a := &UserInternalAPI{DB: newFakeConsentDB()}
+	ctx := context.Background()
+
+	createRes := &api.CreateConsentChallengeResponse{}
+	if err := a.PerformCreateConsentChallenge(ctx, &api.CreateConsentChallengeRequest{
+		LocalPart:     "alice",
+		PolicyVersion: "1.0",
+		TTL:           time.Hour,
+	}, createRes); err != nil {
+		t.Fatalf("PerformCreateConsentChallenge: %s", err)
+	}
+
+	res := &api.ValidateConsentChallengeResponse{}
+	if err := a.QueryConsentChallenge(ctx, &api.ValidateConsentChallengeRequest{Challenge: createRes.Challenge}, res); err != nil {
+		t.Fatalf("QueryConsentChallenge: %s", err)
+	}
+	if !res.Valid || res.LocalPart != "alice" || res.PolicyVersion != "1.0" {
+		t.Fatalf("expected a valid, freshly-issued challenge, got %+v", res)
+	}
+}
+
+func TestQueryConsentChallengeExpired(t *testing.T) {
+	db := newFakeConsentDB()
+	a := &UserInternalAPI{DB: db}
+	ctx := context.Background()
+
+	if err := db.InsertConsentChallenge(ctx, nil, "chal1", "alice", "1.0",
+		time.Now().Add(-2*time.Hour).UnixMilli(), time.Now().Add(-time.Hour).UnixMilli()); err != nil {
+		t.Fatalf("InsertConsentChallenge: %s", err)
+	}
+
+	res := &api.ValidateConsentChallengeResponse{}
+	if err := a.QueryConsentChallenge(ctx, &api.ValidateConsentChallengeRequest{Challenge: "chal1"}, res); err != nil {
+		t.Fatalf("QueryConsentChallenge: %s", err)
+	}
+	if res.Valid {
+		t.Fatalf("expected an expired challenge to be invalid")
+	}
+}
+
+func TestQueryConsentChallengeConsumed(t *testing.T) {
+	a := &UserInternalAPI{DB: newFakeConsentDB()}
+	ctx := context.Background()
+
+	createRes := &api.CreateConsentChallengeResponse{}
+	if err := a.PerformCreateConsentChallenge(ctx, &api.CreateConsentChallengeRequest{
+		LocalPart:     "alice",
+		PolicyVersion: "1.0",
+		TTL:           time.Hour,
+	}, createRes); err != nil {
+		t.Fatalf("PerformCreateConsentChallenge: %s", err)
+	}
+	if err := a.PerformConsumeConsentChallenge(ctx, &api.ConsumeConsentChallengeRequest{
+		Challenge: createRes.Challenge,
+	}, &api.ConsumeConsentChallengeResponse{}); err != nil {
+		t.Fatalf("PerformConsumeConsentChallenge: %s", err)
+	}
+
+	res := &api.ValidateConsentChallengeResponse{}
+	if err := a.QueryConsentChallenge(ctx, &api.ValidateConsentChallengeRequest{Challenge: createRes.Challenge}, res); err != nil {
+		t.Fatalf("QueryConsentChallenge: %s", err)
+	}
+	if res.Valid {
+		t.Fatalf("expected a consumed challenge to be invalid")
+	}
+}
+
+func TestQueryConsentChallengeUnknown(t *testing.T) {
+	a := &UserInternalAPI{DB: newFakeConsentDB()}
+
+	res := &api.ValidateConsentChallengeResponse{}
+	if err := a.QueryConsentChallenge(context.Background(), &api.ValidateConsentChallengeRequest{Challenge: "doesnotexist"}, res); err != nil {
+		t.Fatalf("QueryConsentChallenge: %s", err)
+	}
+	if res.Valid {
+		t.Fatalf("expected an unknown challenge to be invalid")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"context"
+
+	"github.com/matrix-org/dendrite/userapi/storage/tables"
+)
+
+// Database is the storage surface behind UserInternalAPI. The two
+// consent-related tables are embedded directly, matching how the rest of
+// Database surfaces its tables' methods.
+type Database interface {
+	tables.UserPolicyConsents
+	tables.ConsentChallenges
+
+	// SelectOutdatedPolicyLocalparts returns every localpart with no
+	// unrevoked consent row for policyVersion, i.e. everyone who either
+	// never accepted it or has since revoked their acceptance.
+	SelectOutdatedPolicyLocalparts(ctx context.Context, policyVersion string) ([]string, error)
+}
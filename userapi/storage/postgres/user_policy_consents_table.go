@@ -0,0 +1,114 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/matrix-org/dendrite/internal/sqlutil"
+	"github.com/matrix-org/dendrite/userapi/api"
+	"github.com/matrix-org/dendrite/userapi/storage/tables"
+)
+
+const userPolicyConsentsSchema = `
+CREATE TABLE IF NOT EXISTS userapi_user_policy_consents (
+	localpart TEXT NOT NULL,
+	policy_version TEXT NOT NULL,
+	accepted_ts BIGINT NOT NULL,
+	revoked_ts BIGINT NOT NULL DEFAULT 0,
+	method TEXT NOT NULL,
+
+	PRIMARY KEY (localpart, policy_version)
+);
+`
+
+const insertPolicyConsentSQL = "" +
+	"INSERT INTO userapi_user_policy_consents (localpart, policy_version, accepted_ts, revoked_ts, method)" +
+	" VALUES ($1, $2, $3, 0, $4)" +
+	" ON CONFLICT (localpart, policy_version) DO UPDATE SET accepted_ts = $3, revoked_ts = 0, method = $4"
+
+const selectPolicyConsentsSQL = "" +
+	"SELECT policy_version, accepted_ts, revoked_ts, method FROM userapi_user_policy_consents" +
+	" WHERE localpart = $1 ORDER BY accepted_ts DESC"
+
+const selectLatestPolicyConsentSQL = "" +
+	"SELECT policy_version, accepted_ts, revoked_ts, method FROM userapi_user_policy_consents" +
+	" WHERE localpart = $1 ORDER BY accepted_ts DESC LIMIT 1"
+
+const revokePolicyConsentSQL = "" +
+	"UPDATE userapi_user_policy_consents SET revoked_ts = $3" +
+	" WHERE localpart = $1 AND policy_version = $2"
+
+type userPolicyConsentsStatements struct {
+	insertPolicyConsentStmt       *sql.Stmt
+	selectPolicyConsentsStmt      *sql.Stmt
+	selectLatestPolicyConsentStmt *sql.Stmt
+	revokePolicyConsentStmt       *sql.Stmt
+}
+
+// NewPostgresUserPolicyConsentsTable prepares the user_policy_consents
+// statements against db, creating the table first if required.
+func NewPostgresUserPolicyConsentsTable(db *sql.DB) (tables.UserPolicyConsents, error) {
+	s := &userPolicyConsentsStatements{}
+	_, err := db.Exec(userPolicyConsentsSchema)
+	if err != nil {
+		return nil, err
+	}
+	return s, sqlutil.StatementList{
+		{&s.insertPolicyConsentStmt, insertPolicyConsentSQL},
+		{&s.selectPolicyConsentsStmt, selectPolicyConsentsSQL},
+		{&s.selectLatestPolicyConsentStmt, selectLatestPolicyConsentSQL},
+		{&s.revokePolicyConsentStmt, revokePolicyConsentSQL},
+	}.Prepare(db)
+}
+
+func (s *userPolicyConsentsStatements) InsertPolicyConsent(ctx context.Context, txn *sql.Tx, localpart, policyVersion, method string) error {
+	stmt := sqlutil.TxStmt(txn, s.insertPolicyConsentStmt)
+	_, err := stmt.ExecContext(ctx, localpart, policyVersion, time.Now().UnixMilli(), method)
+	return err
+}
+
+func (s *userPolicyConsentsStatements) SelectPolicyConsents(ctx context.Context, localpart string) ([]api.PolicyConsent, error) {
+	rows, err := s.selectPolicyConsentsStmt.QueryContext(ctx, localpart)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint:errcheck
+
+	var consents []api.PolicyConsent
+	for rows.Next() {
+		var c api.PolicyConsent
+		if err = rows.Scan(&c.PolicyVersion, &c.AcceptedAt, &c.RevokedAt, &c.Method); err != nil {
+			return nil, err
+		}
+		consents = append(consents, c)
+	}
+	return consents, rows.Err()
+}
+
+func (s *userPolicyConsentsStatements) SelectLatestPolicyConsent(ctx context.Context, localpart string) (api.PolicyConsent, error) {
+	var c api.PolicyConsent
+	err := s.selectLatestPolicyConsentStmt.QueryRowContext(ctx, localpart).
+		Scan(&c.PolicyVersion, &c.AcceptedAt, &c.RevokedAt, &c.Method)
+	return c, err
+}
+
+func (s *userPolicyConsentsStatements) RevokePolicyConsent(ctx context.Context, txn *sql.Tx, localpart, policyVersion string) error {
+	stmt := sqlutil.TxStmt(txn, s.revokePolicyConsentStmt)
+	_, err := stmt.ExecContext(ctx, localpart, policyVersion, time.Now().UnixMilli())
+	return err
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/internal/sqlutil"
+	"github.com/matrix-org/dendrite/userapi/storage/tables"
+)
+
+const consentChallengesSchema = `
+CREATE TABLE IF NOT EXISTS userapi_consent_challenges (
+	challenge TEXT NOT NULL PRIMARY KEY,
+	localpart TEXT NOT NULL,
+	policy_version TEXT NOT NULL,
+	issued_ts BIGINT NOT NULL,
+	expires_ts BIGINT NOT NULL,
+	consumed BOOLEAN NOT NULL DEFAULT FALSE
+);
+`
+
+const insertConsentChallengeSQL = "" +
+	"INSERT INTO userapi_consent_challenges (challenge, localpart, policy_version, issued_ts, expires_ts, consumed)" +
+	" VALUES ($1, $2, $3, $4, $5, FALSE)"
+
+const selectConsentChallengeSQL = "" +
+	"SELECT challenge, localpart, policy_version, issued_ts, expires_ts, consumed" +
+	" FROM userapi_consent_challenges WHERE challenge = $1"
+
+const consumeConsentChallengeSQL = "" +
+	"UPDATE userapi_consent_challenges SET consumed = TRUE WHERE challenge = $1"
+
+type consentChallengesStatements struct {
+	insertConsentChallengeStmt  *sql.Stmt
+	selectConsentChallengeStmt  *sql.Stmt
+	consumeConsentChallengeStmt *sql.Stmt
+}
+
+// NewSQLiteConsentChallengesTable prepares the consent_challenges
+// statements against db, creating the table first if required.
+func NewSQLiteConsentChallengesTable(db *sql.DB) (tables.ConsentChallenges, error) {
+	s := &consentChallengesStatements{}
+	_, err := db.Exec(consentChallengesSchema)
+	if err != nil {
+		return nil, err
+	}
+	return s, sqlutil.StatementList{
+		{&s.insertConsentChallengeStmt, insertConsentChallengeSQL},
+		{&s.selectConsentChallengeStmt, selectConsentChallengeSQL},
+		{&s.consumeConsentChallengeStmt, consumeConsentChallengeSQL},
+	}.Prepare(db)
+}
+
+func (s *consentChallengesStatements) InsertConsentChallenge(ctx context.Context, txn *sql.Tx, challenge, localpart, policyVersion string, issuedAt, expiresAt int64) error {
+	stmt := sqlutil.TxStmt(txn, s.insertConsentChallengeStmt)
+	_, err := stmt.ExecContext(ctx, challenge, localpart, policyVersion, issuedAt, expiresAt)
+	return err
+}
+
+func (s *consentChallengesStatements) SelectConsentChallenge(ctx context.Context, challenge string) (tables.ConsentChallenge, error) {
+	var c tables.ConsentChallenge
+	err := s.selectConsentChallengeStmt.QueryRowContext(ctx, challenge).
+		Scan(&c.Challenge, &c.LocalPart, &c.PolicyVersion, &c.IssuedAt, &c.ExpiresAt, &c.Consumed)
+	return c, err
+}
+
+func (s *consentChallengesStatements) ConsumeConsentChallenge(ctx context.Context, txn *sql.Tx, challenge string) error {
+	stmt := sqlutil.TxStmt(txn, s.consumeConsentChallengeStmt)
+	_, err := stmt.ExecContext(ctx, challenge)
+	return err
+}
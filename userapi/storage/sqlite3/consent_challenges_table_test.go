@@ -0,0 +1,80 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func mustOpenDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open in-memory database: %s", err)
+	}
+	return db
+}
+
+func TestConsentChallengeLifecycle(t *testing.T) {
+	db := mustOpenDB(t)
+	table, err := NewSQLiteConsentChallengesTable(db)
+	if err != nil {
+		t.Fatalf("NewSQLiteConsentChallengesTable: %s", err)
+	}
+	ctx := context.Background()
+	now := time.Now().UnixMilli()
+
+	if err = table.InsertConsentChallenge(ctx, nil, "chal1", "alice", "1.0", now, now+1000); err != nil {
+		t.Fatalf("InsertConsentChallenge: %s", err)
+	}
+
+	got, err := table.SelectConsentChallenge(ctx, "chal1")
+	if err != nil {
+		t.Fatalf("SelectConsentChallenge: %s", err)
+	}
+	if got.Consumed {
+		t.Fatalf("expected a freshly-issued challenge to be unconsumed")
+	}
+	if got.LocalPart != "alice" || got.PolicyVersion != "1.0" {
+		t.Fatalf("unexpected challenge row: %+v", got)
+	}
+
+	if err = table.ConsumeConsentChallenge(ctx, nil, "chal1"); err != nil {
+		t.Fatalf("ConsumeConsentChallenge: %s", err)
+	}
+	got, err = table.SelectConsentChallenge(ctx, "chal1")
+	if err != nil {
+		t.Fatalf("SelectConsentChallenge after consume: %s", err)
+	}
+	if !got.Consumed {
+		t.Fatalf("expected the challenge to be marked consumed")
+	}
+}
+
+func TestSelectConsentChallengeNotFound(t *testing.T) {
+	db := mustOpenDB(t)
+	table, err := NewSQLiteConsentChallengesTable(db)
+	if err != nil {
+		t.Fatalf("NewSQLiteConsentChallengesTable: %s", err)
+	}
+	if _, err = table.SelectConsentChallenge(context.Background(), "doesnotexist"); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows, got %v", err)
+	}
+}
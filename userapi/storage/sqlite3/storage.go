@@ -0,0 +1,82 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/userapi/storage/tables"
+)
+
+// Database combines the consent-related SQLite tables into the
+// storage.Database surface UserInternalAPI is built on.
+type Database struct {
+	tables.UserPolicyConsents
+	tables.ConsentChallenges
+	DB *sql.DB
+
+	selectOutdatedPolicyLocalpartsStmt *sql.Stmt
+}
+
+const selectOutdatedPolicyLocalpartsSQL = "" +
+	"SELECT localpart FROM account_accounts a" +
+	" WHERE NOT EXISTS (" +
+	"  SELECT 1 FROM userapi_user_policy_consents c" +
+	"  WHERE c.localpart = a.localpart AND c.policy_version = $1 AND c.revoked_ts = 0" +
+	" )"
+
+// NewDatabase wires up the consent-related SQLite tables.
+func NewDatabase(db *sql.DB) (*Database, error) {
+	consents, err := NewSQLiteUserPolicyConsentsTable(db)
+	if err != nil {
+		return nil, err
+	}
+	challenges, err := NewSQLiteConsentChallengesTable(db)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := db.Prepare(selectOutdatedPolicyLocalpartsSQL)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{
+		UserPolicyConsents:                 consents,
+		ConsentChallenges:                  challenges,
+		DB:                                 db,
+		selectOutdatedPolicyLocalpartsStmt: stmt,
+	}, nil
+}
+
+// SelectOutdatedPolicyLocalparts implements storage.Database. A localpart
+// is outdated if it has no row for policyVersion at all, or if its only
+// row for it has since been revoked.
+func (d *Database) SelectOutdatedPolicyLocalparts(ctx context.Context, policyVersion string) ([]string, error) {
+	rows, err := d.selectOutdatedPolicyLocalpartsStmt.QueryContext(ctx, policyVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() // nolint:errcheck
+
+	var localparts []string
+	for rows.Next() {
+		var localpart string
+		if err = rows.Scan(&localpart); err != nil {
+			return nil, err
+		}
+		localparts = append(localparts, localpart)
+	}
+	return localparts, rows.Err()
+}
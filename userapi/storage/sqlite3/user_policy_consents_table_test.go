@@ -0,0 +1,90 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqlite3
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUserPolicyConsentsRevoke(t *testing.T) {
+	db := mustOpenDB(t)
+	table, err := NewSQLiteUserPolicyConsentsTable(db)
+	if err != nil {
+		t.Fatalf("NewSQLiteUserPolicyConsentsTable: %s", err)
+	}
+	ctx := context.Background()
+
+	if err = table.InsertPolicyConsent(ctx, nil, "alice", "1.0", "web"); err != nil {
+		t.Fatalf("InsertPolicyConsent: %s", err)
+	}
+
+	latest, err := table.SelectLatestPolicyConsent(ctx, "alice")
+	if err != nil {
+		t.Fatalf("SelectLatestPolicyConsent: %s", err)
+	}
+	if latest.RevokedAt != 0 {
+		t.Fatalf("expected a freshly-accepted consent to not be revoked")
+	}
+
+	if err = table.RevokePolicyConsent(ctx, nil, "alice", "1.0"); err != nil {
+		t.Fatalf("RevokePolicyConsent: %s", err)
+	}
+
+	latest, err = table.SelectLatestPolicyConsent(ctx, "alice")
+	if err != nil {
+		t.Fatalf("SelectLatestPolicyConsent after revoke: %s", err)
+	}
+	if latest.RevokedAt == 0 {
+		t.Fatalf("expected RevokePolicyConsent to set revoked_ts")
+	}
+
+	consents, err := table.SelectPolicyConsents(ctx, "alice")
+	if err != nil {
+		t.Fatalf("SelectPolicyConsents: %s", err)
+	}
+	if len(consents) != 1 {
+		t.Fatalf("expected 1 consent row, got %d", len(consents))
+	}
+}
+
+func TestInsertPolicyConsentReacceptClearsRevocation(t *testing.T) {
+	db := mustOpenDB(t)
+	table, err := NewSQLiteUserPolicyConsentsTable(db)
+	if err != nil {
+		t.Fatalf("NewSQLiteUserPolicyConsentsTable: %s", err)
+	}
+	ctx := context.Background()
+
+	if err = table.InsertPolicyConsent(ctx, nil, "alice", "1.0", "web"); err != nil {
+		t.Fatalf("InsertPolicyConsent: %s", err)
+	}
+	if err = table.RevokePolicyConsent(ctx, nil, "alice", "1.0"); err != nil {
+		t.Fatalf("RevokePolicyConsent: %s", err)
+	}
+	// Re-accepting the same version should clear the revocation, not
+	// leave a stale revoked_ts sitting alongside a fresh accepted_ts.
+	if err = table.InsertPolicyConsent(ctx, nil, "alice", "1.0", "web"); err != nil {
+		t.Fatalf("InsertPolicyConsent (re-accept): %s", err)
+	}
+
+	latest, err := table.SelectLatestPolicyConsent(ctx, "alice")
+	if err != nil {
+		t.Fatalf("SelectLatestPolicyConsent: %s", err)
+	}
+	if latest.RevokedAt != 0 {
+		t.Fatalf("expected re-accepting to clear revoked_ts, got %d", latest.RevokedAt)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tables
+
+import (
+	"context"
+	"database/sql"
+)
+
+// ConsentChallenge is a single-use, expiring token that stands in for the
+// bare HMAC(userID) previously embedded in consent links. It is looked up
+// by its opaque ID, never by the localpart/policy_version it was issued
+// for, so a leaked link can be revoked without affecting other users.
+type ConsentChallenge struct {
+	Challenge     string
+	LocalPart     string
+	PolicyVersion string
+	IssuedAt      int64
+	ExpiresAt     int64
+	Consumed      bool
+}
+
+// ConsentChallenges backs PerformCreateConsentChallenge and the
+// challenge-based replacement for validHMAC.
+type ConsentChallenges interface {
+	// InsertConsentChallenge records a freshly-issued challenge.
+	InsertConsentChallenge(ctx context.Context, txn *sql.Tx, challenge, localpart, policyVersion string, issuedAt, expiresAt int64) error
+	// SelectConsentChallenge returns the challenge row, or sql.ErrNoRows if
+	// it doesn't exist (already consumed challenges are still returned so
+	// the caller can give a clear "already used" error).
+	SelectConsentChallenge(ctx context.Context, challenge string) (ConsentChallenge, error)
+	// ConsumeConsentChallenge marks challenge as consumed. It is called
+	// exactly once, after the CSRF token and expiry have both been
+	// validated, immediately before PerformUpdatePolicyVersion.
+	ConsumeConsentChallenge(ctx context.Context, txn *sql.Tx, challenge string) error
+}
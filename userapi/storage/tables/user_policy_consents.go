@@ -0,0 +1,42 @@
+// Copyright 2022 The Matrix.org Foundation C.I.C.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tables
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/matrix-org/dendrite/userapi/api"
+)
+
+// UserPolicyConsents tracks every policy version a user has been shown,
+// when they accepted it, and (if applicable) when they withdrew that
+// acceptance. It replaces the single "latest policy version" column that
+// used to live on the account_data/accounts table.
+type UserPolicyConsents interface {
+	// InsertPolicyConsent records that localpart accepted policyVersion at
+	// the current time, via the given method (e.g. "web" or "server-notice").
+	InsertPolicyConsent(ctx context.Context, txn *sql.Tx, localpart, policyVersion, method string) error
+	// SelectPolicyConsents returns every policy version localpart has been
+	// recorded against, newest first.
+	SelectPolicyConsents(ctx context.Context, localpart string) ([]api.PolicyConsent, error)
+	// SelectLatestPolicyConsent returns the most recent consent row for
+	// localpart, or sql.ErrNoRows if none exists yet.
+	SelectLatestPolicyConsent(ctx context.Context, localpart string) (api.PolicyConsent, error)
+	// RevokePolicyConsent marks localpart's acceptance of policyVersion as
+	// revoked as of now, so QueryOutdatedPolicy treats them as outdated
+	// again.
+	RevokePolicyConsent(ctx context.Context, txn *sql.Tx, localpart, policyVersion string) error
+}